@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+
+	httpmdm "github.com/micromdm/nanomdm/http/mdm"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// Flags for the webhook-based CertVerifier. Registered at package scope
+// so they show up alongside the rest of main's flags in -h output.
+var (
+	flCertVerifyWebhookURL    = flag.String("cert-verify-webhook-url", "", "URL of a webhook to POST enrollment certs to for verification")
+	flCertVerifyWebhookSecret = flag.String("cert-verify-webhook-secret", "", "shared secret used to HMAC-sign webhook cert verify requests")
+)
+
+// certVerifierFromFlags builds a mdm.CertVerifier (currently just a
+// *httpmdm.WebhookCertVerifier) from the -cert-verify-webhook-* flags,
+// or nil if -cert-verify-webhook-url was not set.
+func certVerifierFromFlags(logger log.Logger) httpmdm.CertVerifier {
+	if *flCertVerifyWebhookURL == "" {
+		return nil
+	}
+	opts := []httpmdm.WebhookVerifierOption{
+		httpmdm.WithWebhookLogger(logger),
+	}
+	if *flCertVerifyWebhookSecret != "" {
+		opts = append(opts, httpmdm.WithWebhookSecret(*flCertVerifyWebhookSecret))
+	}
+	return httpmdm.NewWebhookCertVerifier(*flCertVerifyWebhookURL, opts...)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	httpmdm "github.com/micromdm/nanomdm/http/mdm"
+	coremdm "github.com/micromdm/nanomdm/mdm"
+
+	"github.com/micromdm/nanolib/log/stdlogfmt"
+)
+
+var (
+	flListen = flag.String("listen", ":9000", "HTTP listen address")
+	flDebug  = flag.Bool("debug", false, "log debug messages")
+)
+
+func main() {
+	flag.Parse()
+
+	logger := stdlogfmt.New(stdlogfmt.WithDebugFlag(*flDebug))
+
+	// checkinAndCommandHandler is where the check-in and
+	// command-and-report-results services would be mounted; storage and
+	// push notification wiring aren't part of this checkout, so this
+	// chunk only covers enrollment cert verification.
+	checkinAndCommandHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	})
+
+	var verifiers []httpmdm.CertVerifier
+	if webhookVerifier := certVerifierFromFlags(logger); webhookVerifier != nil {
+		verifiers = append(verifiers, webhookVerifier)
+	}
+
+	mdmHandler := http.Handler(checkinAndCommandHandler)
+	if len(verifiers) > 0 {
+		mdmHandler = httpmdm.CertVerifyMiddleware(mdmHandler, httpmdm.NewCertVerifierChain(logger, verifiers...), logger)
+	}
+	mdmHandler = httpmdm.CertExtractTLSMiddleware(mdmHandler, logger)
+	mdmHandler = coremdm.RequestIDMiddleware(mdmHandler, logger)
+
+	mux := http.NewServeMux()
+	mux.Handle("/mdm", mdmHandler)
+
+	logger.Info("msg", "starting server", "listen", *flListen)
+	logger.Info("msg", "server shutdown", "err", http.ListenAndServe(*flListen, mux))
+}
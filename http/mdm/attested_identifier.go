@@ -0,0 +1,152 @@
+package mdm
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"net/http"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// oidPermanentIdentifier and oidHardwareModuleName are the otherName
+// type-ids used by step-ca's device-attest-01 ACME challenge and Apple's
+// ACME device attestation to bind a device identity into a certificate's
+// Subject Alternative Name.
+var (
+	oidPermanentIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 3}
+	oidHardwareModuleName  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 4}
+)
+
+type contextKeyPermanentIdentifier struct{}
+
+type contextKeyHardwareModuleName struct{}
+
+// HardwareModuleName is the type and serial number of a hardware module
+// as carried in a device-attest-01 certificate's Subject Alternative
+// Name (RFC 4108).
+type HardwareModuleName struct {
+	Type         asn1.ObjectIdentifier
+	SerialNumber []byte
+}
+
+// otherNameSAN mirrors the ASN.1 GeneralName CHOICE case for otherName:
+//
+//	otherName                       [0]     OtherName
+//	OtherName ::= SEQUENCE {
+//	    type-id    OBJECT IDENTIFIER,
+//	    value      [0] EXPLICIT ANY DEFINED BY type-id }
+type otherNameSAN struct {
+	TypeID asn1.ObjectIdentifier
+	Value  asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// permanentIdentifierValue mirrors RFC 4043's PermanentIdentifier.
+type permanentIdentifierValue struct {
+	IdentifierValue string                `asn1:"utf8,optional"`
+	Assigner        asn1.ObjectIdentifier `asn1:"optional"`
+}
+
+// GetPermanentIdentifier retrieves the device-attest-01 Permanent
+// Identifier stashed on ctx by CertWithAttestedIdentifierMiddleware, or
+// the empty string if none was present.
+func GetPermanentIdentifier(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyPermanentIdentifier{}).(string)
+	return id
+}
+
+// GetHardwareModuleName retrieves the device-attest-01 Hardware Module
+// Name stashed on ctx by CertWithAttestedIdentifierMiddleware, or nil if
+// none was present.
+func GetHardwareModuleName(ctx context.Context) *HardwareModuleName {
+	name, _ := ctx.Value(contextKeyHardwareModuleName{}).(*HardwareModuleName)
+	return name
+}
+
+// parseAttestedIdentifiers walks the raw Subject Alternative Name
+// extension on cert looking for the otherName values used by step-ca's
+// device-attest-01 challenge and Apple's ACME device attestation: a
+// Permanent Identifier (RFC 4043) and/or a Hardware Module Name
+// (RFC 4108). Either return value may be the zero value if cert does not
+// carry it.
+//
+// Unlike GetCert's existing work-around, which only clears the
+// UnhandledCriticalExtensions flag so crypto/x509 doesn't reject the
+// certificate, this actually parses the SAN content.
+func parseAttestedIdentifiers(cert *x509.Certificate) (permanentID string, hwName *HardwareModuleName, err error) {
+	var sanValue []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidSubjectAlternativeName) {
+			sanValue = ext.Value
+			break
+		}
+	}
+	if sanValue == nil {
+		return "", nil, nil
+	}
+
+	var names []asn1.RawValue
+	if _, err := asn1.Unmarshal(sanValue, &names); err != nil {
+		return "", nil, fmt.Errorf("unmarshaling SAN: %w", err)
+	}
+	for _, name := range names {
+		if name.Class != asn1.ClassContextSpecific || name.Tag != 0 {
+			continue // not the otherName GeneralName choice
+		}
+		var other otherNameSAN
+		if _, err := asn1.UnmarshalWithParams(name.FullBytes, &other, "tag:0"); err != nil {
+			continue
+		}
+		switch {
+		case other.TypeID.Equal(oidPermanentIdentifier):
+			var pid permanentIdentifierValue
+			if _, err := asn1.Unmarshal(other.Value.Bytes, &pid); err == nil {
+				permanentID = pid.IdentifierValue
+			}
+		case other.TypeID.Equal(oidHardwareModuleName):
+			var hw HardwareModuleName
+			if _, err := asn1.Unmarshal(other.Value.Bytes, &hw); err == nil {
+				hwName = &hw
+			}
+		}
+	}
+	return permanentID, hwName, nil
+}
+
+// CertWithAttestedIdentifierMiddleware parses the Permanent Identifier
+// and Hardware Module Name, if any, from the SAN of the certificate
+// already on the request context (see GetCert) and stashes them on the
+// context, retrievable with GetPermanentIdentifier and
+// GetHardwareModuleName.
+//
+// next is always called; a missing certificate or SAN is not an error
+// here, as this middleware only enriches the context for handlers
+// further down the chain (such as CertWithEnrollmentIDMiddleware's
+// attested identifier fallback) to make use of.
+func CertWithAttestedIdentifierMiddleware(next http.Handler, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cert := GetCert(r.Context())
+		if cert == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		permanentID, hwName, err := parseAttestedIdentifiers(cert)
+		if err != nil {
+			requestLogger(r.Context(), logger).Info(
+				"msg", "parsing attested identifiers",
+				"err", err,
+			)
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if permanentID != "" {
+			ctx = context.WithValue(ctx, contextKeyPermanentIdentifier{}, permanentID)
+		}
+		if hwName != nil {
+			ctx = context.WithValue(ctx, contextKeyHardwareModuleName{}, hwName)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,145 @@
+package mdm
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// marshalOtherName builds the DER bytes for a GeneralName otherName
+// choice: [0] { type-id OID, value [0] EXPLICIT ANY }. value is the
+// already-marshaled TLV of the ANY (e.g. a permanentIdentifierValue or
+// HardwareModuleName SEQUENCE).
+func marshalOtherName(t *testing.T, typeID asn1.ObjectIdentifier, value []byte) []byte {
+	t.Helper()
+	// encoding/asn1's Marshal, when a RawValue field already has
+	// FullBytes set, inlines those bytes verbatim and does NOT apply the
+	// struct tag's "explicit,tag:0" wrapping. So the explicit [0]
+	// wrapper around value has to be built by hand here rather than
+	// left to otherNameSAN's struct tags.
+	explicitValue, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        0,
+		IsCompound: true,
+		Bytes:      value,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(otherNameSAN{
+		TypeID: typeID,
+		Value:  asn1.RawValue{FullBytes: explicitValue},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// otherNameSAN marshals as a universal SEQUENCE (tag 0x30); the
+	// GeneralName otherName choice is implicitly [0] constructed
+	// instead, so swap the leading tag byte.
+	der[0] = 0xA0
+	return der
+}
+
+// certWithSAN returns a certificate carrying a raw SAN extension made up
+// of the given pre-marshaled GeneralName entries.
+func certWithSAN(t *testing.T, otherNames ...[]byte) *x509.Certificate {
+	t.Helper()
+	var raw []byte
+	for _, on := range otherNames {
+		raw = append(raw, on...)
+	}
+	sanValue, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      raw,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &x509.Certificate{
+		Extensions: []pkix.Extension{
+			{Id: oidSubjectAlternativeName, Value: sanValue},
+		},
+	}
+}
+
+func TestParseAttestedIdentifiersPermanentIdentifier(t *testing.T) {
+	pidValue, err := asn1.Marshal(permanentIdentifierValue{IdentifierValue: "device-123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := certWithSAN(t, marshalOtherName(t, oidPermanentIdentifier, pidValue))
+
+	permanentID, hwName, err := parseAttestedIdentifiers(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if permanentID != "device-123" {
+		t.Fatalf("got permanent identifier %q, want %q", permanentID, "device-123")
+	}
+	if hwName != nil {
+		t.Fatalf("expected no hardware module name, got %+v", hwName)
+	}
+}
+
+func TestParseAttestedIdentifiersHardwareModuleName(t *testing.T) {
+	want := HardwareModuleName{
+		Type:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		SerialNumber: []byte("serial-456"),
+	}
+	hwValue, err := asn1.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := certWithSAN(t, marshalOtherName(t, oidHardwareModuleName, hwValue))
+
+	permanentID, hwName, err := parseAttestedIdentifiers(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if permanentID != "" {
+		t.Fatalf("expected no permanent identifier, got %q", permanentID)
+	}
+	if hwName == nil || !hwName.Type.Equal(want.Type) || string(hwName.SerialNumber) != string(want.SerialNumber) {
+		t.Fatalf("got hardware module name %+v, want %+v", hwName, want)
+	}
+}
+
+func TestParseAttestedIdentifiersNoSAN(t *testing.T) {
+	permanentID, hwName, err := parseAttestedIdentifiers(&x509.Certificate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if permanentID != "" || hwName != nil {
+		t.Fatalf("expected empty result for cert with no SAN, got (%q, %+v)", permanentID, hwName)
+	}
+}
+
+func TestCertWithAttestedIdentifierMiddlewareStashesOnContext(t *testing.T) {
+	pidValue, err := asn1.Marshal(permanentIdentifierValue{IdentifierValue: "device-789"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := certWithSAN(t, marshalOtherName(t, oidPermanentIdentifier, pidValue))
+
+	var got string
+	h := CertWithAttestedIdentifierMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetPermanentIdentifier(r.Context())
+	}), log.NopLogger)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyCert{}, cert))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got != "device-789" {
+		t.Fatalf("got permanent identifier %q, want %q", got, "device-789")
+	}
+}
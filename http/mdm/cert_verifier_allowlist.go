@@ -0,0 +1,50 @@
+package mdm
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// IssuerAllowlistCertVerifier denies certificates whose issuer
+// distinguished name is not in a configured allowlist. This is a simple
+// complement to PoolCertVerifier for operators who trust a CA's chain
+// but only want to accept identities issued by specific intermediates,
+// e.g. a per-fleet or per-region issuing CA.
+//
+// This only allowlists by issuer DN; it does not evaluate X.509 name
+// constraints (those are already enforced by cert.Verify in
+// PoolCertVerifier when the issuing certificate carries them).
+type IssuerAllowlistCertVerifier struct {
+	allowed map[string]bool
+	logger  log.Logger
+}
+
+// NewIssuerAllowlistCertVerifier creates an IssuerAllowlistCertVerifier
+// that only allows certificates issued by one of issuerDNs (as rendered
+// by pkix.Name.String()).
+func NewIssuerAllowlistCertVerifier(logger log.Logger, issuerDNs ...string) *IssuerAllowlistCertVerifier {
+	allowed := make(map[string]bool, len(issuerDNs))
+	for _, dn := range issuerDNs {
+		allowed[dn] = true
+	}
+	return &IssuerAllowlistCertVerifier{allowed: allowed, logger: logger}
+}
+
+// Verify implements CertVerifier.
+func (v *IssuerAllowlistCertVerifier) Verify(_ context.Context, cert *x509.Certificate) error {
+	if cert == nil {
+		return NewCertVerifyError(CertVerifyInvalid, errors.New("no certificate"))
+	}
+	if len(v.allowed) == 0 {
+		return NewCertVerifyError(CertVerifyUnknown, nil)
+	}
+	if issuer := cert.Issuer.String(); !v.allowed[issuer] {
+		v.logger.Info("msg", "issuer not in allowlist", "issuer", issuer)
+		return NewCertVerifyError(CertVerifyInvalid, fmt.Errorf("issuer %q not in allowlist", issuer))
+	}
+	return nil
+}
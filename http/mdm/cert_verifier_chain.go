@@ -0,0 +1,97 @@
+package mdm
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// CertVerifyReason distinguishes why a CertVerifier in a
+// CertVerifierChain did or did not allow a certificate.
+type CertVerifyReason int
+
+const (
+	// CertVerifyUnknown means this verifier had no opinion on cert (for
+	// example, it isn't covered by the verifier's configuration) and
+	// the chain should defer to the next verifier.
+	CertVerifyUnknown CertVerifyReason = iota
+	// CertVerifyRevoked means cert was explicitly revoked.
+	CertVerifyRevoked
+	// CertVerifyInvalid means cert failed validation for a reason other
+	// than revocation, e.g. chain or name-constraint failure.
+	CertVerifyInvalid
+)
+
+func (r CertVerifyReason) String() string {
+	switch r {
+	case CertVerifyRevoked:
+		return "revoked"
+	case CertVerifyInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// CertVerifyError is the error type CertVerifiers in a
+// CertVerifierChain should return to indicate why they denied (or had
+// no opinion on) a certificate, so CertVerifyMiddleware can log the
+// reason without changing its "never 401" policy.
+type CertVerifyError struct {
+	Reason CertVerifyReason
+	Err    error
+}
+
+func (e *CertVerifyError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+	}
+	return e.Reason.String()
+}
+
+func (e *CertVerifyError) Unwrap() error {
+	return e.Err
+}
+
+// NewCertVerifyError returns a *CertVerifyError with the given reason
+// and wrapped error.
+func NewCertVerifyError(reason CertVerifyReason, err error) *CertVerifyError {
+	return &CertVerifyError{Reason: reason, Err: err}
+}
+
+// CertVerifierChain runs an ordered list of CertVerifiers and
+// short-circuits on the first one that denies with CertVerifyRevoked or
+// CertVerifyInvalid. A verifier that returns CertVerifyUnknown (or any
+// error not wrapped as a *CertVerifyError) is logged and skipped,
+// deferring the decision to the rest of the chain. If every verifier is
+// unknown or allows, the chain allows.
+type CertVerifierChain struct {
+	verifiers []CertVerifier
+	logger    log.Logger
+}
+
+// NewCertVerifierChain creates a CertVerifierChain that runs verifiers
+// in order.
+func NewCertVerifierChain(logger log.Logger, verifiers ...CertVerifier) *CertVerifierChain {
+	return &CertVerifierChain{verifiers: verifiers, logger: logger}
+}
+
+// Verify implements CertVerifier.
+func (c *CertVerifierChain) Verify(ctx context.Context, cert *x509.Certificate) error {
+	for _, v := range c.verifiers {
+		err := v.Verify(ctx, cert)
+		if err == nil {
+			continue
+		}
+		var verifyErr *CertVerifyError
+		if !errors.As(err, &verifyErr) || verifyErr.Reason == CertVerifyUnknown {
+			c.logger.Debug("msg", "cert verifier had no opinion", "err", err)
+			continue
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package mdm
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+type fakeCertVerifier struct {
+	err error
+}
+
+func (f fakeCertVerifier) Verify(context.Context, *x509.Certificate) error {
+	return f.err
+}
+
+type fakeCertVerifierFunc func(context.Context, *x509.Certificate) error
+
+func (f fakeCertVerifierFunc) Verify(ctx context.Context, cert *x509.Certificate) error {
+	return f(ctx, cert)
+}
+
+func TestCertVerifierChainAllowsWhenAllUnknown(t *testing.T) {
+	chain := NewCertVerifierChain(log.NopLogger,
+		fakeCertVerifier{err: NewCertVerifyError(CertVerifyUnknown, nil)},
+		fakeCertVerifier{err: NewCertVerifyError(CertVerifyUnknown, nil)},
+	)
+	if err := chain.Verify(context.Background(), nil); err != nil {
+		t.Fatalf("expected allow, got %v", err)
+	}
+}
+
+func TestCertVerifierChainAllowsOnNilError(t *testing.T) {
+	chain := NewCertVerifierChain(log.NopLogger, fakeCertVerifier{err: nil})
+	if err := chain.Verify(context.Background(), nil); err != nil {
+		t.Fatalf("expected allow, got %v", err)
+	}
+}
+
+func TestCertVerifierChainShortCircuitsOnRevoked(t *testing.T) {
+	var secondCalled bool
+	second := fakeCertVerifierFunc(func(context.Context, *x509.Certificate) error {
+		secondCalled = true
+		return nil
+	})
+	chain := NewCertVerifierChain(log.NopLogger,
+		fakeCertVerifier{err: NewCertVerifyError(CertVerifyRevoked, errors.New("nope"))},
+		second,
+	)
+	err := chain.Verify(context.Background(), nil)
+	if err == nil {
+		t.Fatal("expected deny")
+	}
+	var verifyErr *CertVerifyError
+	if !errors.As(err, &verifyErr) || verifyErr.Reason != CertVerifyRevoked {
+		t.Fatalf("expected CertVerifyRevoked, got %v", err)
+	}
+	if secondCalled {
+		t.Fatal("expected chain to short-circuit before the second verifier")
+	}
+}
+
+func TestCertVerifierChainDefersOnUnknownThenDenies(t *testing.T) {
+	chain := NewCertVerifierChain(log.NopLogger,
+		fakeCertVerifier{err: NewCertVerifyError(CertVerifyUnknown, nil)},
+		fakeCertVerifier{err: NewCertVerifyError(CertVerifyInvalid, errors.New("bad chain"))},
+	)
+	err := chain.Verify(context.Background(), nil)
+	if err == nil {
+		t.Fatal("expected deny")
+	}
+	var verifyErr *CertVerifyError
+	if !errors.As(err, &verifyErr) || verifyErr.Reason != CertVerifyInvalid {
+		t.Fatalf("expected CertVerifyInvalid, got %v", err)
+	}
+}
+
+// TestCertVerifierChainSkipsUntypedError covers a verifier returning a
+// plain error instead of a *CertVerifyError: the chain should treat it
+// like "unknown" (log and defer) rather than denying outright.
+func TestCertVerifierChainSkipsUntypedError(t *testing.T) {
+	chain := NewCertVerifierChain(log.NopLogger, fakeCertVerifier{err: errors.New("oops")})
+	if err := chain.Verify(context.Background(), nil); err != nil {
+		t.Fatalf("expected allow, got %v", err)
+	}
+}
+
+func TestOCSPCertVerifierUsesCache(t *testing.T) {
+	v := NewOCSPCertVerifier(&x509.Certificate{}, time.Hour, log.NopLogger)
+	cert := &x509.Certificate{OCSPServer: []string{"http://should-not-be-queried.invalid"}}
+	v.cache[ocspCacheKey(cert)] = ocspCacheEntry{status: ocsp.Revoked, expiresAt: time.Now().Add(time.Minute)}
+
+	err := v.Verify(context.Background(), cert)
+	var verifyErr *CertVerifyError
+	if !errors.As(err, &verifyErr) || verifyErr.Reason != CertVerifyRevoked {
+		t.Fatalf("expected CertVerifyRevoked served from cache, got %v", err)
+	}
+}
+
+// TestOCSPCertVerifierCacheExpiry covers the cache-expiry math: once
+// expiresAt has passed, Verify must not trust the stale (Good) entry and
+// goes on to a live lookup. The empty issuer makes building the OCSP
+// request fail before anything is sent, which yields CertVerifyUnknown.
+func TestOCSPCertVerifierCacheExpiry(t *testing.T) {
+	v := NewOCSPCertVerifier(&x509.Certificate{}, time.Hour, log.NopLogger)
+	cert := &x509.Certificate{OCSPServer: []string{"http://127.0.0.1:0"}} // unreachable
+	v.cache[ocspCacheKey(cert)] = ocspCacheEntry{status: ocsp.Good, expiresAt: time.Now().Add(-time.Minute)}
+
+	err := v.Verify(context.Background(), cert)
+	var verifyErr *CertVerifyError
+	if !errors.As(err, &verifyErr) || verifyErr.Reason != CertVerifyUnknown {
+		t.Fatalf("expected CertVerifyUnknown once the expired cache entry is bypassed for a (failing) live lookup, got %v", err)
+	}
+}
+
+func TestResultFromOCSPStatus(t *testing.T) {
+	if err := resultFromOCSPStatus(ocsp.Good); err != nil {
+		t.Fatalf("expected nil for ocsp.Good, got %v", err)
+	}
+	var verifyErr *CertVerifyError
+	if err := resultFromOCSPStatus(ocsp.Revoked); !errors.As(err, &verifyErr) || verifyErr.Reason != CertVerifyRevoked {
+		t.Fatalf("expected CertVerifyRevoked for ocsp.Revoked, got %v", err)
+	}
+	if err := resultFromOCSPStatus(ocsp.Unknown); !errors.As(err, &verifyErr) || verifyErr.Reason != CertVerifyUnknown {
+		t.Fatalf("expected CertVerifyUnknown for ocsp.Unknown, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package mdm
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// CRLCertVerifier checks a certificate's serial number against
+// periodically-refreshed CRLs fetched from the distribution points given
+// to Start. A fetched CRL is only consulted for a certificate whose own
+// CRLDistributionPoints include its URL. Call Start in a goroutine to
+// begin refreshing; Verify uses whatever was last fetched.
+type CRLCertVerifier struct {
+	issuer          *x509.Certificate
+	client          *http.Client
+	refreshInterval time.Duration
+	logger          log.Logger
+
+	mu      sync.RWMutex
+	revoked map[string]map[string]bool // distribution point -> serial -> revoked
+}
+
+// NewCRLCertVerifier creates a CRLCertVerifier that refreshes its
+// distribution points every refreshInterval. Fetched CRLs are only
+// trusted if signed by issuer.
+func NewCRLCertVerifier(issuer *x509.Certificate, refreshInterval time.Duration, logger log.Logger) *CRLCertVerifier {
+	return &CRLCertVerifier{
+		issuer:          issuer,
+		client:          &http.Client{Timeout: 30 * time.Second},
+		refreshInterval: refreshInterval,
+		logger:          logger,
+		revoked:         make(map[string]map[string]bool),
+	}
+}
+
+// Start fetches distributionPoints immediately, then refreshes them
+// every refreshInterval until ctx is cancelled. Intended to be run in
+// its own goroutine.
+func (v *CRLCertVerifier) Start(ctx context.Context, distributionPoints []string) {
+	v.refresh(ctx, distributionPoints)
+	ticker := time.NewTicker(v.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v.refresh(ctx, distributionPoints)
+		}
+	}
+}
+
+func (v *CRLCertVerifier) refresh(ctx context.Context, distributionPoints []string) {
+	for _, dp := range distributionPoints {
+		revoked, err := v.fetch(ctx, dp)
+		if err != nil {
+			v.logger.Info("msg", "refreshing CRL", "url", dp, "err", err)
+			continue
+		}
+		v.mu.Lock()
+		v.revoked[dp] = revoked
+		v.mu.Unlock()
+	}
+}
+
+func (v *CRLCertVerifier) fetch(ctx context.Context, url string) (map[string]bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	list, err := x509.ParseRevocationList(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRL: %w", err)
+	}
+	if err := list.CheckSignatureFrom(v.issuer); err != nil {
+		return nil, fmt.Errorf("checking CRL signature: %w", err)
+	}
+	revoked := make(map[string]bool, len(list.RevokedCertificateEntries))
+	for _, entry := range list.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.String()] = true
+	}
+	return revoked, nil
+}
+
+// Verify implements CertVerifier.
+func (v *CRLCertVerifier) Verify(_ context.Context, cert *x509.Certificate) error {
+	if cert == nil || len(cert.CRLDistributionPoints) == 0 {
+		return NewCertVerifyError(CertVerifyUnknown, nil)
+	}
+	serial := cert.SerialNumber.String()
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, dp := range cert.CRLDistributionPoints {
+		revoked, ok := v.revoked[dp]
+		if !ok {
+			continue
+		}
+		if revoked[serial] {
+			return NewCertVerifyError(CertVerifyRevoked, fmt.Errorf("certificate %s revoked per CRL %s", serial, dp))
+		}
+	}
+	return nil
+}
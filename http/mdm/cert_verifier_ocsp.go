@@ -0,0 +1,125 @@
+package mdm
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// ocspCacheEntry is a cached OCSP response status, keyed by issuer and
+// serial number.
+type ocspCacheEntry struct {
+	status    int
+	expiresAt time.Time
+}
+
+// OCSPCertVerifier checks a certificate's revocation status via OCSP,
+// following the responder URL(s) in the certificate's
+// AuthorityInformationAccess extension. Responses are cached per
+// issuer+serial until the response's NextUpdate, capped by ttl.
+type OCSPCertVerifier struct {
+	issuer *x509.Certificate
+	client *http.Client
+	ttl    time.Duration
+	logger log.Logger
+
+	mu    sync.Mutex
+	cache map[string]ocspCacheEntry
+}
+
+// NewOCSPCertVerifier creates an OCSPCertVerifier that verifies
+// certificates issued by issuer, caching responses for at most ttl.
+func NewOCSPCertVerifier(issuer *x509.Certificate, ttl time.Duration, logger log.Logger) *OCSPCertVerifier {
+	return &OCSPCertVerifier{
+		issuer: issuer,
+		client: &http.Client{Timeout: 10 * time.Second},
+		ttl:    ttl,
+		logger: logger,
+		cache:  make(map[string]ocspCacheEntry),
+	}
+}
+
+func ocspCacheKey(cert *x509.Certificate) string {
+	return cert.Issuer.String() + ":" + cert.SerialNumber.String()
+}
+
+// Verify implements CertVerifier.
+func (v *OCSPCertVerifier) Verify(ctx context.Context, cert *x509.Certificate) error {
+	if cert == nil || len(cert.OCSPServer) == 0 {
+		return NewCertVerifyError(CertVerifyUnknown, nil)
+	}
+
+	key := ocspCacheKey(cert)
+	v.mu.Lock()
+	entry, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return resultFromOCSPStatus(entry.status)
+	}
+
+	reqBytes, err := ocsp.CreateRequest(cert, v.issuer, nil)
+	if err != nil {
+		return NewCertVerifyError(CertVerifyUnknown, fmt.Errorf("building OCSP request: %w", err))
+	}
+
+	var resp *ocsp.Response
+	for _, url := range cert.OCSPServer {
+		resp, err = v.query(ctx, url, reqBytes, cert)
+		if err == nil {
+			break
+		}
+		v.logger.Info("msg", "querying OCSP responder", "url", url, "err", err)
+	}
+	if err != nil {
+		return NewCertVerifyError(CertVerifyUnknown, fmt.Errorf("querying OCSP responder: %w", err))
+	}
+
+	expiresAt := resp.NextUpdate
+	if ttlCeiling := time.Now().Add(v.ttl); expiresAt.IsZero() || ttlCeiling.Before(expiresAt) {
+		expiresAt = ttlCeiling
+	}
+	v.mu.Lock()
+	v.cache[key] = ocspCacheEntry{status: resp.Status, expiresAt: expiresAt}
+	v.mu.Unlock()
+
+	return resultFromOCSPStatus(resp.Status)
+}
+
+func (v *OCSPCertVerifier) query(ctx context.Context, url string, reqBytes []byte, cert *x509.Certificate) (*ocsp.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	httpResp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ocsp.ParseResponseForCert(body, cert, v.issuer)
+}
+
+func resultFromOCSPStatus(status int) error {
+	switch status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return NewCertVerifyError(CertVerifyRevoked, errors.New("OCSP: certificate revoked"))
+	default:
+		return NewCertVerifyError(CertVerifyUnknown, errors.New("OCSP: unknown status"))
+	}
+}
@@ -0,0 +1,42 @@
+package mdm
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// PoolCertVerifier verifies a certificate's chain against a configured
+// root pool, optionally constrained to a set of extended key usages.
+type PoolCertVerifier struct {
+	pool      *x509.CertPool
+	keyUsages []x509.ExtKeyUsage
+	logger    log.Logger
+}
+
+// NewPoolCertVerifier creates a PoolCertVerifier that verifies against
+// pool. If keyUsages is empty, x509.ExtKeyUsageAny is used.
+func NewPoolCertVerifier(pool *x509.CertPool, logger log.Logger, keyUsages ...x509.ExtKeyUsage) *PoolCertVerifier {
+	if len(keyUsages) == 0 {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	return &PoolCertVerifier{pool: pool, keyUsages: keyUsages, logger: logger}
+}
+
+// Verify implements CertVerifier.
+func (v *PoolCertVerifier) Verify(_ context.Context, cert *x509.Certificate) error {
+	if cert == nil {
+		return NewCertVerifyError(CertVerifyInvalid, errors.New("no certificate"))
+	}
+	opts := x509.VerifyOptions{
+		Roots:     v.pool,
+		KeyUsages: v.keyUsages,
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		v.logger.Info("msg", "chain verification failed", "err", err)
+		return NewCertVerifyError(CertVerifyInvalid, err)
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/micromdm/nanomdm/cryptoutil"
 	mdmhttp "github.com/micromdm/nanomdm/http"
+	coremdm "github.com/micromdm/nanomdm/mdm"
 	"github.com/micromdm/nanomdm/storage"
 
 	"github.com/micromdm/nanolib/log"
@@ -21,6 +22,17 @@ var contextEnrollmentID struct{}
 
 var oidSubjectAlternativeName = asn1.ObjectIdentifier{2, 5, 29, 17}
 
+// requestLogger returns a logger enriched with the context's ctxlog
+// fields as well as the request ID (if any), so that logs from these
+// middlewares can be correlated with the request that produced them.
+func requestLogger(ctx context.Context, logger log.Logger) log.Logger {
+	logger = ctxlog.Logger(ctx, logger)
+	if id := coremdm.GetRequestID(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	return logger
+}
+
 // CertExtractPEMHeaderMiddleware extracts the MDM enrollment identity
 // certificate from the request into the HTTP request context. It looks
 // at the request header which should be a URL-encoded PEM certificate.
@@ -30,7 +42,7 @@ var oidSubjectAlternativeName = asn1.ObjectIdentifier{2, 5, 29, 17}
 // similar header could be used, of course.
 func CertExtractPEMHeaderMiddleware(next http.Handler, header string, logger log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger := ctxlog.Logger(r.Context(), logger)
+		logger := requestLogger(r.Context(), logger)
 		escapedCert := r.Header.Get(header)
 		if escapedCert == "" {
 			logger.Debug("msg", "empty header", "header", header)
@@ -60,7 +72,7 @@ func CertExtractPEMHeaderMiddleware(next http.Handler, header string, logger log
 func CertExtractTLSMiddleware(next http.Handler, logger log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.TLS == nil || len(r.TLS.PeerCertificates) < 1 {
-			ctxlog.Logger(r.Context(), logger).Debug(
+			requestLogger(r.Context(), logger).Debug(
 				"msg", "no TLS peer certificate",
 			)
 			next.ServeHTTP(w, r)
@@ -116,7 +128,7 @@ func CertExtractMdmSignatureMiddleware(next http.Handler, opts ...SigLogOption)
 		opt(config)
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger := ctxlog.Logger(r.Context(), config.logger)
+		logger := requestLogger(r.Context(), config.logger)
 		mdmSig := r.Header.Get("Mdm-Signature")
 		if mdmSig == "" {
 			logger.Debug("msg", "empty Mdm-Signature header")
@@ -147,6 +159,11 @@ func CertExtractMdmSignatureMiddleware(next http.Handler, opts ...SigLogOption)
 
 // GetCert retrieves the MDM enrollment identity certificate
 // from the HTTP request context.
+//
+// Note this only works around crypto/x509 rejecting a critical SAN it
+// doesn't understand; it does not parse the SAN's contents. For
+// device-attest-01 Permanent Identifier / Hardware Module Name
+// extraction see CertWithAttestedIdentifierMiddleware.
 func GetCert(ctx context.Context) *x509.Certificate {
 	cert, _ := ctx.Value(contextKeyCert{}).(*x509.Certificate)
 
@@ -178,14 +195,17 @@ type CertVerifier interface {
 }
 
 // CertVerifyMiddleware checks the MDM certificate against verifier and
-// returns an error if it fails.
+// returns an error if it fails. verifier is commonly a
+// *CertVerifierChain, whose verifiers return *CertVerifyError so the
+// reason (revoked or invalid) ends up in the log line below; the chain
+// itself skips verifiers that report unknown.
 //
 // We deliberately do not reply with 401 as this may cause unintentional
 // MDM unenrollments in the case of bugs or something going wrong.
 func CertVerifyMiddleware(next http.Handler, verifier CertVerifier, logger log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := verifier.Verify(r.Context(), GetCert(r.Context())); err != nil {
-			ctxlog.Logger(r.Context(), logger).Info(
+			requestLogger(r.Context(), logger).Info(
 				"msg", "error verifying MDM certificate",
 				"err", err,
 			)
@@ -204,6 +224,41 @@ func GetEnrollmentID(ctx context.Context) string {
 
 type HashFn func(*x509.Certificate) string
 
+// PermanentIdentifierResolver resolves a certificate's Permanent
+// Identifier (see GetPermanentIdentifier) to an enrollment ID, for
+// example by looking it up against a CA's own device records. Returning
+// an empty string and a nil error means "no such enrollment".
+type PermanentIdentifierResolver func(context.Context, string) (string, error)
+
+// enrollmentIDConfig is a configuration struct for CertWithEnrollmentIDMiddleware.
+type enrollmentIDConfig struct {
+	resolver PermanentIdentifierResolver
+}
+
+// EnrollmentIDOption sets configurations for CertWithEnrollmentIDMiddleware.
+type EnrollmentIDOption func(*enrollmentIDConfig)
+
+// WithAttestedIdentifierFallback enables an additional lookup mode: if
+// the certificate's hash has no matching enrollment in store, but the
+// certificate carries a Permanent Identifier (see
+// CertWithAttestedIdentifierMiddleware), resolver is used to resolve it
+// to an enrollment ID. Passing a nil resolver uses the Permanent
+// Identifier directly as the enrollment ID.
+//
+// This lets nanomdm work directly with ACME-issued device-attested
+// certs where the CA binds the device identity into the SAN rather than
+// requiring a separate cert-hash association step.
+func WithAttestedIdentifierFallback(resolver PermanentIdentifierResolver) EnrollmentIDOption {
+	if resolver == nil {
+		resolver = func(_ context.Context, permanentID string) (string, error) {
+			return permanentID, nil
+		}
+	}
+	return func(c *enrollmentIDConfig) {
+		c.resolver = resolver
+	}
+}
+
 // CertWithEnrollmentIDMiddleware tries to associate the enrollment ID to the request context.
 // It does this by looking up the certificate on the context, hashing it with
 // hasher, looking up the hash in storage, and setting the ID on the context.
@@ -211,15 +266,19 @@ type HashFn func(*x509.Certificate) string
 // The next handler will be called even if cert or ID is not found unless
 // enforce is true. This way next is able to use the existence of the ID on
 // the context to make its own decisions.
-func CertWithEnrollmentIDMiddleware(next http.Handler, hasher HashFn, store storage.CertAuthRetriever, enforce bool, logger log.Logger) http.HandlerFunc {
+func CertWithEnrollmentIDMiddleware(next http.Handler, hasher HashFn, store storage.CertAuthRetriever, enforce bool, logger log.Logger, opts ...EnrollmentIDOption) http.HandlerFunc {
 	if store == nil || hasher == nil {
 		panic("store and hasher must not be nil")
 	}
+	config := new(enrollmentIDConfig)
+	for _, opt := range opts {
+		opt(config)
+	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		cert := GetCert(r.Context())
 		if cert == nil {
 			if enforce {
-				ctxlog.Logger(r.Context(), logger).Info(
+				requestLogger(r.Context(), logger).Info(
 					"err", "missing certificate",
 				)
 				// we cannot send a 401 to the client as it has MDM protocol semantics
@@ -227,7 +286,7 @@ func CertWithEnrollmentIDMiddleware(next http.Handler, hasher HashFn, store stor
 				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusBadRequest)
 				return
 			} else {
-				ctxlog.Logger(r.Context(), logger).Debug(
+				requestLogger(r.Context(), logger).Debug(
 					"msg", "missing certificate",
 				)
 				next.ServeHTTP(w, r)
@@ -236,22 +295,35 @@ func CertWithEnrollmentIDMiddleware(next http.Handler, hasher HashFn, store stor
 		}
 		id, err := store.EnrollmentFromHash(r.Context(), hasher(cert))
 		if err != nil {
-			ctxlog.Logger(r.Context(), logger).Info(
+			requestLogger(r.Context(), logger).Info(
 				"msg", "retreiving enrollment from hash",
 				"err", err,
 			)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
+		if id == "" && config.resolver != nil {
+			if permanentID := GetPermanentIdentifier(r.Context()); permanentID != "" {
+				id, err = config.resolver(r.Context(), permanentID)
+				if err != nil {
+					requestLogger(r.Context(), logger).Info(
+						"msg", "resolving permanent identifier",
+						"err", err,
+					)
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+			}
+		}
 		if id == "" {
 			if enforce {
-				ctxlog.Logger(r.Context(), logger).Info(
+				requestLogger(r.Context(), logger).Info(
 					"err", "missing enrollment id",
 				)
 				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusBadRequest)
 				return
 			} else {
-				ctxlog.Logger(r.Context(), logger).Debug(
+				requestLogger(r.Context(), logger).Debug(
 					"msg", "missing enrollment id",
 				)
 				next.ServeHTTP(w, r)
@@ -0,0 +1,235 @@
+package mdm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	coremdm "github.com/micromdm/nanomdm/mdm"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+// webhookCertRequest is the JSON body POSTed to a WebhookCertVerifier's URL.
+type webhookCertRequest struct {
+	PEM                 string    `json:"pem"`
+	SHA256              string    `json:"sha256"`
+	Subject             string    `json:"subject"`
+	SANs                []string  `json:"sans,omitempty"`
+	PermanentIdentifier string    `json:"permanent_identifier,omitempty"`
+	NotBefore           time.Time `json:"not_before"`
+	NotAfter            time.Time `json:"not_after"`
+	EnrollmentID        string    `json:"enrollment_id,omitempty"`
+	RequestID           string    `json:"request_id,omitempty"`
+}
+
+// certSANs collects every GeneralName SAN form on cert that Go's x509
+// package exposes (DNS, IP, URI, email) into a single flat slice so
+// webhooks see the whole picture instead of just DNS names.
+func certSANs(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses)+len(cert.URIs)+len(cert.EmailAddresses))
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	return sans
+}
+
+// webhookCertResponse is the optional JSON body a webhook may reply with to
+// deny a certificate. Any 2xx response with no body (or a body that fails
+// to decode as this shape) is treated as an allow.
+type webhookCertResponse struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+// WebhookVerifierOption configures a WebhookCertVerifier.
+type WebhookVerifierOption func(*WebhookCertVerifier)
+
+// WithWebhookSecret sets the shared secret used to HMAC-sign outgoing
+// requests. If unset, requests are sent unsigned.
+func WithWebhookSecret(secret string) WebhookVerifierOption {
+	return func(v *WebhookCertVerifier) {
+		v.secret = secret
+	}
+}
+
+// WithWebhookTimeout sets the per-attempt HTTP timeout. Defaults to 5s.
+func WithWebhookTimeout(d time.Duration) WebhookVerifierOption {
+	return func(v *WebhookCertVerifier) {
+		v.client.Timeout = d
+	}
+}
+
+// WithWebhookMaxRetries sets how many additional attempts are made after a
+// 5xx response or network error, with exponential backoff between each.
+// Defaults to 2.
+func WithWebhookMaxRetries(n int) WebhookVerifierOption {
+	return func(v *WebhookCertVerifier) {
+		v.maxRetries = n
+	}
+}
+
+// WithWebhookBackoff sets the base delay used for the exponential backoff
+// between retries. Defaults to 500ms.
+func WithWebhookBackoff(d time.Duration) WebhookVerifierOption {
+	return func(v *WebhookCertVerifier) {
+		v.backoff = d
+	}
+}
+
+// WithWebhookLogger sets the logger used to report retries and errors.
+func WithWebhookLogger(logger log.Logger) WebhookVerifierOption {
+	return func(v *WebhookCertVerifier) {
+		v.logger = logger
+	}
+}
+
+// WebhookCertVerifier is a CertVerifier that delegates the allow/deny
+// decision to an external HTTP endpoint. It is intended for operators who
+// want to make enrollment authorization decisions outside of nanomdm, for
+// example against a CA's own issuance records.
+type WebhookCertVerifier struct {
+	url        string
+	secret     string
+	client     *http.Client
+	maxRetries int
+	backoff    time.Duration
+	logger     log.Logger
+}
+
+// NewWebhookCertVerifier creates a WebhookCertVerifier that POSTs to url.
+func NewWebhookCertVerifier(url string, opts ...WebhookVerifierOption) *WebhookCertVerifier {
+	v := &WebhookCertVerifier{
+		url:        url,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		maxRetries: 2,
+		backoff:    500 * time.Millisecond,
+		logger:     log.NopLogger,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// sign computes the X-Webhook-Signature value for body as sent at ts.
+func (v *WebhookCertVerifier) sign(ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(v.secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify implements CertVerifier by POSTing a description of cert to the
+// configured webhook URL.
+func (v *WebhookCertVerifier) Verify(ctx context.Context, cert *x509.Certificate) error {
+	if cert == nil {
+		return NewCertVerifyError(CertVerifyInvalid, errors.New("webhook cert verifier: no certificate"))
+	}
+
+	body, err := json.Marshal(webhookCertRequest{
+		PEM:                 string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+		SHA256:              fmt.Sprintf("%x", sha256.Sum256(cert.Raw)),
+		Subject:             cert.Subject.String(),
+		SANs:                certSANs(cert),
+		PermanentIdentifier: GetPermanentIdentifier(ctx),
+		NotBefore:           cert.NotBefore,
+		NotAfter:            cert.NotAfter,
+		EnrollmentID:        GetEnrollmentID(ctx),
+		RequestID:           coremdm.GetRequestID(ctx),
+	})
+	if err != nil {
+		return fmt.Errorf("webhook cert verifier: marshaling request: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= v.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := v.backoff * time.Duration(1<<uint(attempt-1))
+			v.logger.Debug("msg", "retrying webhook cert verifier", "attempt", attempt, "delay", delay, "err", lastErr)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+		allow, retryable, err := v.do(ctx, body)
+		if err == nil {
+			if !allow {
+				return NewCertVerifyError(CertVerifyInvalid, errors.New("webhook cert verifier: denied"))
+			}
+			return nil
+		}
+		lastErr = err
+		if !retryable {
+			break
+		}
+	}
+	return fmt.Errorf("webhook cert verifier: %w", lastErr)
+}
+
+// do performs a single attempt, returning whether the cert was allowed and
+// whether a failure is worth retrying.
+func (v *WebhookCertVerifier) do(ctx context.Context, body []byte) (allow bool, retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(body))
+	if err != nil {
+		return false, false, fmt.Errorf("building request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if reqID := coremdm.GetRequestID(ctx); reqID != "" {
+		req.Header.Set(coremdm.RequestIDHeader, reqID)
+	}
+	if v.secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", ts)
+		req.Header.Set("X-Webhook-Signature", v.sign(ts, body))
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, true, fmt.Errorf("performing request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return false, true, fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode >= 500 {
+		return false, true, fmt.Errorf("webhook returned %d: %s", resp.StatusCode, respBody)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, false, fmt.Errorf("webhook returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	if len(respBody) == 0 {
+		return true, false, nil
+	}
+	// A 2xx response only denies if it explicitly says so; any other
+	// body (unparseable, missing "allow", or "allow":true) is an allow.
+	decoded := webhookCertResponse{Allow: true}
+	if err := json.Unmarshal(respBody, &decoded); err != nil {
+		return true, false, nil
+	}
+	if !decoded.Allow {
+		v.logger.Info("msg", "webhook denied certificate", "reason", decoded.Reason)
+	}
+	return decoded.Allow, false, nil
+}
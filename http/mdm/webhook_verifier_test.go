@@ -0,0 +1,126 @@
+package mdm
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookCertVerifierAllow(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	v := NewWebhookCertVerifier(srv.URL)
+	if err := v.Verify(context.Background(), &x509.Certificate{}); err != nil {
+		t.Fatalf("expected allow, got %v", err)
+	}
+}
+
+func TestWebhookCertVerifierDeny(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"allow":false,"reason":"not on file"}`))
+	}))
+	defer srv.Close()
+
+	v := NewWebhookCertVerifier(srv.URL)
+	if err := v.Verify(context.Background(), &x509.Certificate{}); err == nil {
+		t.Fatal("expected deny")
+	}
+}
+
+// TestWebhookCertVerifierAllowsUnrecognizedBody covers the bug where a
+// 2xx body that doesn't explicitly set "allow" (e.g. purely
+// informational JSON) was treated as a deny because of Go's zero value
+// for bool.
+func TestWebhookCertVerifierAllowsUnrecognizedBody(t *testing.T) {
+	bodies := []string{`{"reason":"audited"}`, `{}`}
+	for _, body := range bodies {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(body))
+		}))
+		v := NewWebhookCertVerifier(srv.URL)
+		err := v.Verify(context.Background(), &x509.Certificate{})
+		srv.Close()
+		if err != nil {
+			t.Errorf("body %q: expected allow, got %v", body, err)
+		}
+	}
+}
+
+func TestWebhookCertVerifierSignature(t *testing.T) {
+	const secret = "shh"
+	var gotSig, gotTS string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get("X-Webhook-Signature")
+		gotTS = r.Header.Get("X-Webhook-Timestamp")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	v := NewWebhookCertVerifier(srv.URL, WithWebhookSecret(secret))
+	if err := v.Verify(context.Background(), &x509.Certificate{}); err != nil {
+		t.Fatal(err)
+	}
+	if gotSig == "" || gotTS == "" {
+		t.Fatal("expected signature headers to be set")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(gotTS))
+	mac.Write([]byte("."))
+	mac.Write(gotBody)
+	want := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if gotSig != want {
+		t.Fatalf("signature mismatch: got %s want %s", gotSig, want)
+	}
+}
+
+func TestWebhookCertVerifierRetries5xx(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	v := NewWebhookCertVerifier(srv.URL, WithWebhookMaxRetries(2), WithWebhookBackoff(time.Millisecond))
+	if err := v.Verify(context.Background(), &x509.Certificate{}); err != nil {
+		t.Fatalf("expected eventual allow after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestWebhookCertVerifierNoRetryOn4xx(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	v := NewWebhookCertVerifier(srv.URL, WithWebhookMaxRetries(2), WithWebhookBackoff(time.Millisecond))
+	if err := v.Verify(context.Background(), &x509.Certificate{}); err == nil {
+		t.Fatal("expected deny")
+	}
+	if calls != 1 {
+		t.Fatalf("expected no retries on 4xx, got %d calls", calls)
+	}
+}
@@ -0,0 +1,88 @@
+package mdm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/micromdm/nanolib/log"
+	"github.com/micromdm/nanolib/log/ctxlog"
+)
+
+type contextKeyRequestID struct{}
+
+// RequestIDHeader is the HTTP header used to carry a request ID both
+// inbound (from a reverse proxy or caller) and outbound (echoed on the
+// response) by RequestIDMiddleware.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds inbound request IDs so a misbehaving or hostile
+// caller can't stuff arbitrarily large values into our logs.
+const maxRequestIDLen = 64
+
+// requestIDChars is the allowed character set for an inbound request ID:
+// letters, digits, and the separators commonly used by ULIDs, UUIDs, and
+// trace IDs.
+const requestIDChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_."
+
+// GetRequestID retrieves the request ID stashed on ctx by
+// RequestIDMiddleware, or the empty string if none is present.
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKeyRequestID{}).(string)
+	return id
+}
+
+// isValidRequestID reports whether id is non-empty, within the length
+// cap, and composed entirely of requestIDChars.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool {
+		return !strings.ContainsRune(requestIDChars, r)
+	}) == -1
+}
+
+// newRequestID generates a UUIDv7 (RFC 9562): a 48-bit millisecond Unix
+// timestamp followed by random bits. This keeps generated IDs roughly
+// sortable by time, which is useful when correlating log lines.
+func newRequestID() string {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	b[0], b[1], b[2], b[3], b[4], b[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	if _, err := rand.Read(b[6:]); err != nil {
+		// crypto/rand failing is effectively unrecoverable; fall back to
+		// an all-zero random portion rather than panicking.
+	}
+	b[6] = (b[6] & 0x0f) | 0x70 // version 7
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// RequestIDMiddleware ensures every request carries a request ID,
+// accepting it from the inbound X-Request-ID header when present and
+// valid, or generating a UUIDv7 otherwise. The ID is stashed on the
+// request context (retrievable with GetRequestID), echoed back on the
+// response, and logged.
+//
+// This is intended to give operators end-to-end correlation across a
+// reverse proxy, nanomdm, and anything nanomdm calls out to (such as a
+// WebhookCertVerifier), mirroring the request-ID tracing pattern used by
+// upstream CA projects.
+func RequestIDMiddleware(next http.Handler, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), contextKeyRequestID{}, id)
+		ctxlog.Logger(ctx, logger).Debug("msg", "assigned request id", "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
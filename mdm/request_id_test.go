@@ -0,0 +1,97 @@
+package mdm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micromdm/nanolib/log"
+)
+
+func TestIsValidRequestID(t *testing.T) {
+	cases := []struct {
+		id    string
+		valid bool
+	}{
+		{"", false},
+		{"abc123-DEF_456.789", true},
+		{strings.Repeat("a", maxRequestIDLen), true},
+		{strings.Repeat("a", maxRequestIDLen+1), false},
+		{"has spaces", false},
+		{"has/slash", false},
+	}
+	for _, c := range cases {
+		if got := isValidRequestID(c.id); got != c.valid {
+			t.Errorf("isValidRequestID(%q) = %v, want %v", c.id, got, c.valid)
+		}
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	id := newRequestID()
+	if !isValidRequestID(id) {
+		t.Fatalf("generated request id %q is not valid per isValidRequestID", id)
+	}
+	const uuidLen = 36 // 32 hex chars + 4 hyphens
+	if len(id) != uuidLen {
+		t.Fatalf("generated request id %q has length %d, want %d", id, len(id), uuidLen)
+	}
+	if id[14] != '7' {
+		t.Fatalf("generated request id %q does not carry UUID version 7 in the expected position", id)
+	}
+	if id2 := newRequestID(); id2 == id {
+		t.Fatal("two calls to newRequestID produced the same id")
+	}
+}
+
+func TestRequestIDMiddlewareGeneratesWhenAbsent(t *testing.T) {
+	var gotID string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = GetRequestID(r.Context())
+	}), log.NopLogger)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if gotID == "" {
+		t.Fatal("expected a generated request id on the context")
+	}
+	if rec.Header().Get(RequestIDHeader) != gotID {
+		t.Fatalf("response header %q = %q, want %q", RequestIDHeader, rec.Header().Get(RequestIDHeader), gotID)
+	}
+}
+
+func TestRequestIDMiddlewarePropagatesValidInbound(t *testing.T) {
+	const inbound = "caller-supplied-id-123"
+	var gotID string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = GetRequestID(r.Context())
+	}), log.NopLogger)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, inbound)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if gotID != inbound {
+		t.Fatalf("got request id %q, want inbound id %q", gotID, inbound)
+	}
+}
+
+func TestRequestIDMiddlewareReplacesInvalidInbound(t *testing.T) {
+	var gotID string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = GetRequestID(r.Context())
+	}), log.NopLogger)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "has spaces/and slashes")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if !isValidRequestID(gotID) {
+		t.Fatalf("expected invalid inbound id to be replaced with a valid one, got %q", gotID)
+	}
+}
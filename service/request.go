@@ -31,7 +31,7 @@ func NewHTTPStatusError(status int, err error) *HTTPStatusError {
 func CheckinRequest(svc Checkin, r *mdm.Request, bodyBytes []byte) ([]byte, error) {
 	msg, err := mdm.DecodeCheckin(bodyBytes)
 	if err != nil {
-		return nil, NewHTTPStatusError(http.StatusBadRequest, fmt.Errorf("decoding check-in: %w", err))
+		return nil, NewHTTPStatusError(http.StatusBadRequest, withRequestID(r, fmt.Errorf("decoding check-in: %w", err)))
 	}
 	var respBytes []byte
 	switch m := msg.(type) {
@@ -69,9 +69,22 @@ func CheckinRequest(svc Checkin, r *mdm.Request, bodyBytes []byte) ([]byte, erro
 			err = fmt.Errorf("marshal bootstrap token: %w", err)
 		}
 	default:
-		return nil, NewHTTPStatusError(http.StatusBadRequest, mdm.ErrUnrecognizedMessageType)
+		return nil, NewHTTPStatusError(http.StatusBadRequest, withRequestID(r, mdm.ErrUnrecognizedMessageType))
 	}
-	return respBytes, err
+	return respBytes, withRequestID(r, err)
+}
+
+// withRequestID annotates err, if non-nil, with the request ID carried on
+// r's context (if any), so that downstream logs and error responses can be
+// correlated with the originating request.
+func withRequestID(r *mdm.Request, err error) error {
+	if err == nil {
+		return nil
+	}
+	if id := mdm.GetRequestID(r.Context()); id != "" {
+		return fmt.Errorf("request %s: %w", id, err)
+	}
+	return err
 }
 
 // CommandAndReportResultsRequest is a simple adapter that takes the raw
@@ -80,11 +93,11 @@ func CheckinRequest(svc Checkin, r *mdm.Request, bodyBytes []byte) ([]byte, erro
 func CommandAndReportResultsRequest(svc CommandAndReportResults, r *mdm.Request, bodyBytes []byte) ([]byte, error) {
 	report, err := mdm.DecodeCommandResults(bodyBytes)
 	if err != nil {
-		return nil, NewHTTPStatusError(http.StatusBadRequest, fmt.Errorf("decoding command results: %w", err))
+		return nil, NewHTTPStatusError(http.StatusBadRequest, withRequestID(r, fmt.Errorf("decoding command results: %w", err)))
 	}
 	cmd, err := svc.CommandAndReportResults(r, report)
 	if err != nil {
-		return nil, fmt.Errorf("command and report results service: %w", err)
+		return nil, withRequestID(r, fmt.Errorf("command and report results service: %w", err))
 	}
 	if cmd != nil {
 		return cmd.Raw, nil